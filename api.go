@@ -1,6 +1,7 @@
 package api2go
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
@@ -8,6 +9,7 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -33,8 +35,22 @@ type DataSource interface {
 	Update(obj interface{}) error
 }
 
+// PaginatedDataSource is an optional extension of DataSource. When a source
+// implements it, `handleIndex` calls `PaginatedFindAll` instead of `FindAll`
+// so it can return the total number of objects alongside the page requested
+// by the client, independent of how many objects are in `objs`.
+type PaginatedDataSource interface {
+	// PaginatedFindAll returns the objects for the requested page plus the
+	// total number of objects across all pages.
+	PaginatedFindAll(req Request) (objs interface{}, count uint, err error)
+}
+
 // Controller provides more customization of each route.
 // You can define a controller for every DataSource if needed
+//
+// Deprecated: use a Middleware passed to API.Use or AddResourceWithMiddleware
+// instead. AddResourceWithController still works - it installs the
+// Controller as a Middleware under the hood.
 type Controller interface {
 	// FindAll gets called after resource was called
 	FindAll(r *http.Request, objs *interface{}) error
@@ -57,11 +73,46 @@ type API struct {
 	router *httprouter.Router
 	// Route prefix, including slashes
 	prefix string
+	// middleware runs for every resource registered on this API, ahead of
+	// any middleware installed for a single resource.
+	middleware []Middleware
+	// compression holds the options set via SetCompressionOptions, or nil
+	// if response compression is disabled.
+	compression *CompressionOptions
+	// timeout bounds every request via WithTimeout, or 0 to leave requests
+	// bounded only by the client's own context.
+	timeout time.Duration
+	// resources lists every resource registered via addResource, in
+	// registration order, so API.OpenAPI can walk them.
+	resources []*resource
+	// trimTrailingSlashes, set via the TrimTrailingSlashes Option, redirects
+	// a request for "/posts/" to "/posts" before it reaches httprouter.
+	trimTrailingSlashes bool
+	// srv is the *http.Server owned by Start/StartTLS, used by Stop to
+	// drain in-flight requests.
+	srv *http.Server
+	// operationsRegistered tracks whether the shared POST /operations
+	// route has been installed yet.
+	operationsRegistered bool
+}
+
+// Option configures an API at construction time. Pass one or more to
+// NewAPI.
+type Option func(*API)
+
+// TrimTrailingSlashes redirects requests with a trailing slash (e.g.
+// "/posts/") to their slash-free equivalent before they reach httprouter,
+// which treats the two as distinct routes. JSON API clients frequently send
+// the trailing slash, so this mirrors the behavior of other Go routers.
+func TrimTrailingSlashes() Option {
+	return func(api *API) {
+		api.trimTrailingSlashes = true
+	}
 }
 
 // NewAPI returns an initialized API instance
 // `prefix` is added in front of all endpoints.
-func NewAPI(prefix string) *API {
+func NewAPI(prefix string, opts ...Option) *API {
 	// Add initial and trailing slash to prefix
 	prefix = strings.Trim(prefix, "/")
 	if len(prefix) > 0 {
@@ -70,22 +121,40 @@ func NewAPI(prefix string) *API {
 		prefix = "/"
 	}
 
-	return &API{
+	api := &API{
 		router: httprouter.New(),
 		prefix: prefix,
 	}
+	for _, opt := range opts {
+		opt(api)
+	}
+	return api
 }
 
 // Request holds additional information for FindOne and Find Requests
 type Request struct {
 	QueryParams map[string][]string
+	Pagination  Pagination
+	Sorting     []SortField
+	Fields      map[string][]string
+	Filters     map[string][]string
+	// Context carries the request's cancellation signal - derived from
+	// http.Request.Context and, if API.WithTimeout is set, bounded by it.
+	// A DataSource should check it (e.g. pass it to a database call, or
+	// poll Context.Err between steps of a slow FindAll) to stop work the
+	// client can no longer see the result of.
+	Context context.Context
 }
 
 type resource struct {
-	resourceType reflect.Type
-	source       DataSource
-	name         string
-	controller   Controller
+	resourceType        reflect.Type
+	source              DataSource
+	name                string
+	prefix              string
+	middleware          []Middleware
+	compressionDisabled bool
+	openAPITags         []string
+	openAPIDescription  string
 }
 
 func (api *API) addResource(prototype interface{}, source DataSource) *resource {
@@ -98,6 +167,7 @@ func (api *API) addResource(prototype interface{}, source DataSource) *resource
 	res := resource{
 		resourceType: resourceType,
 		name:         name,
+		prefix:       api.prefix,
 		source:       source,
 	}
 
@@ -111,42 +181,153 @@ func (api *API) addResource(prototype interface{}, source DataSource) *resource
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	api.router.GET(api.prefix+name, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		err := res.handleIndex(w, r)
-		if err != nil {
-			handleError(err, w)
-		}
-	})
+	if _, ok := source.(StreamingDataSource); ok {
+		api.router.GET(api.prefix+name, res.streamRoute(api))
+	} else {
+		api.router.GET(api.prefix+name, res.route(api, ActionFindAll, func(c *Context) error {
+			return res.handleIndex(c)
+		}, nil))
+	}
 
-	api.router.GET(api.prefix+name+"/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		err := res.handleRead(w, r, ps)
-		if err != nil {
-			handleError(err, w)
+	api.router.GET(api.prefix+name+"/:id", res.route(api, ActionFindOne, func(c *Context) error {
+		return res.handleRead(c)
+	}, nil))
+
+	api.router.POST(api.prefix+name, res.route(api, ActionCreate, func(c *Context) error {
+		return res.handleCreate(c, api.prefix)
+	}, res.decodeCreate))
+
+	api.router.DELETE(api.prefix+name+"/:id", res.route(api, ActionDelete, func(c *Context) error {
+		return res.handleDelete(c)
+	}, nil))
+
+	api.router.PUT(api.prefix+name+"/:id", res.route(api, ActionUpdate, func(c *Context) error {
+		return res.handleUpdate(c)
+	}, res.decodeUpdate))
+
+	if !api.operationsRegistered {
+		api.router.POST(api.prefix+"operations", api.route(routeOptions{
+			resourceName: "operations",
+			action:       ActionOperations,
+		}, api.handleOperations, nil))
+		api.operationsRegistered = true
+	}
+
+	api.resources = append(api.resources, &res)
+	return &res
+}
+
+// route builds the httprouter.Handle for one of res's CRUD actions, via
+// api.route - see its doc comment for what every route (resource-scoped or
+// not) shares.
+func (res *resource) route(api *API, action Action, term Handler, decode func(c *Context) error) httprouter.Handle {
+	return api.route(routeOptions{
+		resourceName: res.name,
+		action:       action,
+		resource:     res,
+		respond:      res.respond,
+	}, term, decode)
+}
+
+// routeOptions customizes api.route for the resource (or lack of one) a
+// handler is being built for.
+type routeOptions struct {
+	resourceName string
+	action       Action
+	// resource is read for its middleware and compressionDisabled on every
+	// request, not copied out here, so AddResourceWithMiddleware,
+	// AddResourceWithController and DisableCompression - all of which
+	// mutate the resource after addResource has already built its routes -
+	// still take effect. nil for routes, like /operations, not scoped to a
+	// single resource.
+	resource *resource
+	// respond writes c's final response once term (and decode, if any)
+	// succeed. If nil, term is expected to have written the response
+	// itself - used by routes, like /operations, that don't map onto a
+	// single resource's respond.
+	respond func(c *Context) error
+}
+
+// route builds the httprouter.Handle for one route: it assembles the
+// Context, wraps term with an optional decode step and opts.resource's
+// middleware, wraps that in turn with API.Use's global middleware, and
+// finally calls opts.respond - so every route, not just resource CRUD, gets
+// compression, the configured timeout, and the full middleware chain.
+//
+// Global middleware wraps decode, so an auth/rate-limit middleware
+// registered via API.Use can reject a request before decode ever touches
+// the DataSource (e.g. decodeUpdate's FindOne). Resource-level middleware -
+// including the legacy Controller adapter, which expects c.Result already
+// populated - wraps only term, so it still runs after decode the way it did
+// before this route existed.
+//
+// Everything here runs on the request's own goroutine, in sequence - api2go
+// never races a handler against the timeout deadline on a second goroutine,
+// since an abandoned handler that later touches c.ResponseWriter would then
+// be writing concurrently with whatever runs next, and any panic in it would
+// escape net/http's per-connection recovery. A handler or DataSource that
+// ignores a Context past its deadline simply keeps running; once it
+// returns, respond's ctx.Err() check turns the result into the same 504/499
+// a cooperative one would have produced sooner.
+func (api *API) route(opts routeOptions, term Handler, decode func(c *Context) error) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		var resourceMiddleware []Middleware
+		compressionDisabled := false
+		if opts.resource != nil {
+			resourceMiddleware = opts.resource.middleware
+			compressionDisabled = opts.resource.compressionDisabled
 		}
-	})
 
-	api.router.POST(api.prefix+name, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		err := res.handleCreate(w, r, api.prefix)
-		if err != nil {
-			handleError(err, w)
+		cw := newCompressingResponseWriter(w, r, api.compression, compressionDisabled)
+		defer cw.Close()
+
+		stdCtx := r.Context()
+		if api.timeout > 0 {
+			var cancel context.CancelFunc
+			stdCtx, cancel = context.WithTimeout(stdCtx, api.timeout)
+			defer cancel()
 		}
-	})
 
-	api.router.DELETE(api.prefix+name+"/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		err := res.handleDelete(w, r, ps)
+		req, err := buildRequest(r)
 		if err != nil {
-			handleError(err, w)
+			handleError(err, cw)
+			return
+		}
+		req.Context = stdCtx
+
+		c := &Context{
+			ResponseWriter: cw,
+			Request:        r,
+			Params:         ps,
+			Req:            req,
+			ResourceName:   opts.resourceName,
+			Action:         opts.action,
+			StdContext:     stdCtx,
 		}
-	})
 
-	api.router.PUT(api.prefix+name+"/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		err := res.handleUpdate(w, r, ps)
-		if err != nil {
-			handleError(err, w)
+		withResourceMiddleware := chain(term, resourceMiddleware)
+		withDecode := withResourceMiddleware
+		if decode != nil {
+			next := withResourceMiddleware
+			withDecode = func(c *Context) error {
+				if err := decode(c); err != nil {
+					return err
+				}
+				return next(c)
+			}
 		}
-	})
+		h := chain(withDecode, api.middleware)
 
-	return &res
+		if err := h(c); err != nil {
+			handleError(err, cw)
+			return
+		}
+		if opts.respond != nil {
+			if err := opts.respond(c); err != nil {
+				handleError(err, cw)
+			}
+		}
+	}
 }
 
 // AddResource registers a data source for the given resource
@@ -157,155 +338,232 @@ func (api *API) AddResource(prototype interface{}, source DataSource) {
 
 // AddResourceWithController does the same as `AddResource` but also couples a custom `Controller`
 // Use this controller to implement access control and other things that depend on the request
-func (api *API) AddResourceWithController(prototype interface{}, source DataSource, controller Controller) {
+//
+// Deprecated: use AddResourceWithMiddleware instead. This installs
+// controller as a Middleware for backward compatibility.
+func (api *API) AddResourceWithController(prototype interface{}, source DataSource, controller Controller) *resource {
 	res := api.addResource(prototype, source)
-	res.controller = controller
+	res.middleware = append(res.middleware, controllerMiddleware(controller))
+	return res
 }
 
-func buildRequest(r *http.Request) Request {
+func buildRequest(r *http.Request) (Request, error) {
 	req := Request{}
 	params := make(map[string][]string)
 	for key, values := range r.URL.Query() {
 		params[key] = strings.Split(values[0], ",")
 	}
 	req.QueryParams = params
-	return req
+
+	pagination, err := parsePagination(params)
+	if err != nil {
+		return Request{}, err
+	}
+	req.Pagination = pagination
+	req.Sorting, err = parseSorting(params)
+	if err != nil {
+		return Request{}, err
+	}
+	req.Fields = parseBracketedParams(params, "fields")
+	req.Filters = parseBracketedParams(params, "filter")
+	req.Context = r.Context()
+
+	return req, nil
 }
 
-func (res *resource) handleIndex(w http.ResponseWriter, r *http.Request) error {
-	objs, err := res.source.FindAll(buildRequest(r))
+// handleIndex is the terminal Handler for ActionFindAll: it loads the
+// objects (and, via PaginatedDataSource, the total count for pagination
+// links) into c.Result and leaves responding to res.respond.
+func (res *resource) handleIndex(c *Context) error {
+	var (
+		objs  interface{}
+		count uint
+		err   error
+	)
+	if paginated, ok := res.source.(PaginatedDataSource); ok {
+		objs, count, err = paginated.PaginatedFindAll(c.Req)
+	} else {
+		objs, err = res.source.FindAll(c.Req)
+	}
 	if err != nil {
 		return err
 	}
+	c.Result = objs
 
-	if res.controller != nil {
-		if err := res.controller.FindAll(r, &objs); err != nil {
-			return err
-		}
+	if _, ok := res.source.(PaginatedDataSource); ok {
+		c.Meta = map[string]interface{}{"count": count}
+		c.Links = buildPaginationLinks(res.prefix+res.name, c.Req.Pagination, count)
 	}
-	return respondWith(objs, http.StatusOK, w)
+	return nil
 }
 
-func (res *resource) handleRead(w http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
-	ids := strings.Split(ps.ByName("id"), ",")
+// handleRead is the terminal Handler for ActionFindOne.
+func (res *resource) handleRead(c *Context) error {
+	ids := strings.Split(c.Params.ByName("id"), ",")
 
 	var (
 		obj interface{}
 		err error
 	)
-
 	if len(ids) == 1 {
-		obj, err = res.source.FindOne(ids[0], buildRequest(r))
+		obj, err = res.source.FindOne(ids[0], c.Req)
 	} else {
-		obj, err = res.source.FindMultiple(ids, buildRequest(r))
+		obj, err = res.source.FindMultiple(ids, c.Req)
 	}
-
 	if err != nil {
 		return err
 	}
 
-	if res.controller != nil {
-		if err := res.controller.FindOne(r, &obj); err != nil {
-			return err
-		}
-	}
-	return respondWith(obj, http.StatusOK, w)
+	c.Result = obj
+	return nil
 }
 
-func (res *resource) handleCreate(w http.ResponseWriter, r *http.Request, prefix string) error {
-	ctx, err := unmarshalJSONRequest(r)
+// decodeCreate unmarshals the POST body into a new resourceType instance and
+// stores it on c.Result before the resource's own middleware runs, so those
+// Middlewares (including the deprecated Controller adapter) see the decoded
+// object; API.Use middleware wraps this step and runs before it. When
+// the body's `data` is an array and the source implements BulkDataSource,
+// c.Result is instead a []interface{} of decoded objects.
+func (res *resource) decodeCreate(c *Context) error {
+	body, err := unmarshalJSONRequest(c.Request)
 	if err != nil {
 		return err
 	}
-	newObjs := reflect.MakeSlice(reflect.SliceOf(res.resourceType), 0, 0)
-	err = unmarshalInto(ctx, res.resourceType, &newObjs)
+
+	if entries, ok := body["data"].([]interface{}); ok {
+		if _, ok := res.source.(BulkDataSource); !ok {
+			return NewHTTPError(nil, res.name+" does not support bulk create", http.StatusNotImplemented)
+		}
+		objs := make([]interface{}, 0, len(entries))
+		for _, entry := range entries {
+			obj, err := res.decodeOne(map[string]interface{}{"data": entry})
+			if err != nil {
+				return err
+			}
+			objs = append(objs, obj)
+		}
+		c.Result = objs
+		return nil
+	}
+
+	obj, err := res.decodeOne(body)
 	if err != nil {
 		return err
 	}
-	if newObjs.Len() != 1 {
-		return errors.New("expected one object in POST")
+	c.Result = obj
+	return nil
+}
+
+// decodeOne unmarshals a single JSON API document body into one
+// resourceType instance.
+func (res *resource) decodeOne(body map[string]interface{}) (interface{}, error) {
+	objs := reflect.MakeSlice(reflect.SliceOf(res.resourceType), 0, 0)
+	if err := unmarshalInto(body, res.resourceType, &objs); err != nil {
+		return nil, err
+	}
+	if objs.Len() != 1 {
+		return nil, errors.New("expected one object in POST")
 	}
+	return objs.Index(0).Interface(), nil
+}
 
-	newObj := newObjs.Index(0).Interface()
+// handleCreate is the terminal Handler for ActionCreate: it persists
+// c.Result (already decoded by decodeCreate) and reloads it for the
+// response. A []interface{} c.Result is dispatched through BulkDataSource
+// instead of DataSource.Create, and yields c.Locations rather than a single
+// Location header.
+func (res *resource) handleCreate(c *Context, prefix string) error {
+	if objs, ok := c.Result.([]interface{}); ok {
+		bulk := res.source.(BulkDataSource)
+		ids, err := bulk.CreateMany(objs)
+		if err != nil {
+			return err
+		}
 
-	if res.controller != nil {
-		if err := res.controller.Create(r, &newObj); err != nil {
+		created, err := res.source.FindMultiple(ids, c.Req)
+		if err != nil {
 			return err
 		}
+		c.Result = created
+
+		c.Locations = make([]string, len(ids))
+		for i, id := range ids {
+			c.Locations[i] = prefix + res.name + "/" + id
+		}
+		return nil
 	}
 
-	id, err := res.source.Create(newObj)
+	id, err := res.source.Create(c.Result)
 	if err != nil {
 		return err
 	}
-	w.Header().Set("Location", prefix+res.name+"/"+id)
+	c.ResponseWriter.Header().Set("Location", prefix+res.name+"/"+id)
 
-	obj, err := res.source.FindOne(id, buildRequest(r))
+	obj, err := res.source.FindOne(id, c.Req)
 	if err != nil {
 		return err
 	}
-
-	return respondWith(obj, http.StatusCreated, w)
+	c.Result = obj
+	return nil
 }
 
-func (res *resource) handleUpdate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
-	obj, err := res.source.FindOne(ps.ByName("id"), buildRequest(r))
+// decodeUpdate loads the existing object and merges the PUT body into it,
+// storing the merged object on c.Result before the resource's own middleware
+// runs; API.Use middleware wraps this step and runs before it.
+func (res *resource) decodeUpdate(c *Context) error {
+	obj, err := res.source.FindOne(c.Params.ByName("id"), c.Req)
 	if err != nil {
 		return err
 	}
-	ctx, err := unmarshalJSONRequest(r)
+
+	body, err := unmarshalJSONRequest(c.Request)
 	if err != nil {
 		return err
 	}
 	updatingObjs := reflect.MakeSlice(reflect.SliceOf(res.resourceType), 1, 1)
 	updatingObjs.Index(0).Set(reflect.ValueOf(obj))
-	err = unmarshalInto(ctx, res.resourceType, &updatingObjs)
-	if err != nil {
+	if err := unmarshalInto(body, res.resourceType, &updatingObjs); err != nil {
 		return err
 	}
 	if updatingObjs.Len() != 1 {
 		return errors.New("expected one object in PUT")
 	}
-
-	updatingObj := updatingObjs.Index(0).Interface()
-	if res.controller != nil {
-		if err := res.controller.Update(r, &updatingObj); err != nil {
-			return err
-		}
-	}
-
-	if err := res.source.Update(updatingObj); err != nil {
-		return err
-	}
-	w.WriteHeader(http.StatusNoContent)
+	c.Result = updatingObjs.Index(0).Interface()
 	return nil
 }
 
-func (res *resource) handleDelete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
-	id := ps.ByName("id")
-	if res.controller != nil {
-		if err := res.controller.Delete(r, id); err != nil {
-			return err
-		}
-	}
+// handleUpdate is the terminal Handler for ActionUpdate.
+func (res *resource) handleUpdate(c *Context) error {
+	return res.source.Update(c.Result)
+}
 
-	err := res.source.Delete(ps.ByName("id"))
-	if err != nil {
-		return err
-	}
-	w.WriteHeader(http.StatusNoContent)
-	return nil
+// handleDelete is the terminal Handler for ActionDelete.
+func (res *resource) handleDelete(c *Context) error {
+	return res.source.Delete(c.Params.ByName("id"))
 }
 
-func respondWith(obj interface{}, status int, w http.ResponseWriter) error {
-	data, err := MarshalToJSON(obj)
-	if err != nil {
-		return err
+// respond writes the final JSON API response for c, honoring the pagination
+// meta/links and sparse fieldsets computed earlier in the chain. It always
+// runs after the middleware chain, so a Middleware never needs to know how
+// to marshal a JSON API document.
+func (res *resource) respond(c *Context) error {
+	if err := c.StdContext.Err(); err != nil {
+		return translateContextErr(err)
+	}
+
+	switch c.Action {
+	case ActionUpdate, ActionDelete:
+		c.ResponseWriter.WriteHeader(http.StatusNoContent)
+		return nil
+	case ActionCreate:
+		var meta map[string]interface{}
+		if len(c.Locations) > 0 {
+			meta = map[string]interface{}{"locations": c.Locations}
+		}
+		return respondWithPaginationAndFields(c.Result, http.StatusCreated, c.ResponseWriter, meta, nil, c.Req.Fields[res.name])
+	default:
+		return respondWithPaginationAndFields(c.Result, http.StatusOK, c.ResponseWriter, c.Meta, c.Links, c.Req.Fields[res.name])
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	w.Write(data)
-	return nil
 }
 
 func unmarshalJSONRequest(r *http.Request) (map[string]interface{}, error) {
@@ -338,5 +596,8 @@ func handleError(err error, w http.ResponseWriter) {
 
 // Handler returns the http.Handler instance for the API.
 func (api *API) Handler() http.Handler {
-	return api.router
+	if !api.trimTrailingSlashes {
+		return api.router
+	}
+	return trimTrailingSlashHandler(api.router, api.prefix)
 }
@@ -0,0 +1,99 @@
+package api2go
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// blockingMiddleware rejects every request before next ever runs, so a test
+// can assert whatever it wraps (the DataSource, a later middleware) was
+// never reached.
+func blockingMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			return NewHTTPError(nil, "forbidden", http.StatusForbidden)
+		}
+	}
+}
+
+func TestAddResourceWithMiddlewareAppliesToRequests(t *testing.T) {
+	api := NewAPI("")
+	src := &recordingSource{}
+	api.AddResourceWithMiddleware(widget{}, src, blockingMiddleware())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/widgets", nil)
+	api.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if src.findAllCalled {
+		t.Fatal("DataSource.FindAll was called, want the middleware to have blocked the request first")
+	}
+}
+
+// blockingController is a Controller whose Create hook rejects every
+// request, so a test can assert AddResourceWithController's Middleware
+// adapter actually runs it.
+type blockingController struct {
+	stubController
+	called bool
+}
+
+func (c *blockingController) Create(r *http.Request, obj *interface{}) error {
+	c.called = true
+	return NewHTTPError(nil, "forbidden", http.StatusForbidden)
+}
+
+// stubController implements Controller with no-op hooks so embedding types
+// only need to override the one they care about.
+type stubController struct{}
+
+func (stubController) FindAll(r *http.Request, objs *interface{}) error { return nil }
+func (stubController) FindOne(r *http.Request, obj *interface{}) error { return nil }
+func (stubController) Create(r *http.Request, obj *interface{}) error  { return nil }
+func (stubController) Delete(r *http.Request, id string) error        { return nil }
+func (stubController) Update(r *http.Request, obj *interface{}) error { return nil }
+
+func TestAddResourceWithControllerInvokesHooks(t *testing.T) {
+	api := NewAPI("")
+	src := &recordingSource{}
+	controller := &blockingController{}
+	api.AddResourceWithController(widget{}, src, controller)
+
+	rec := httptest.NewRecorder()
+	body := `{"data":{"type":"widgets","attributes":{"name":"gizmo"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/widgets", strings.NewReader(body))
+	api.Handler().ServeHTTP(rec, req)
+
+	if !controller.called {
+		t.Fatal("Controller.Create was never invoked")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if src.createCalled {
+		t.Fatal("DataSource.Create was called, want the controller's Create hook to have blocked the request first")
+	}
+}
+
+func TestGlobalMiddlewareRunsBeforeDecode(t *testing.T) {
+	api := NewAPI("")
+	api.Use(blockingMiddleware())
+	src := &recordingSource{}
+	api.AddResource(widget{}, src)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/widgets/1", strings.NewReader(`{}`))
+	api.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if src.findOneCalled {
+		t.Fatal("decodeUpdate's FindOne ran, want the global middleware to reject before decode touches the DataSource")
+	}
+}
@@ -0,0 +1,210 @@
+package api2go
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+)
+
+// BulkDataSource is an optional extension of DataSource for bulk/atomic
+// write use cases: a batch POST to a resource's collection route, or an
+// operation dispatched through the shared /operations endpoint.
+type BulkDataSource interface {
+	// CreateMany creates every object in objs and returns their new IDs,
+	// in the same order.
+	CreateMany(objs []interface{}) ([]string, error)
+
+	// UpdateMany updates every object in objs.
+	UpdateMany(objs []interface{}) error
+
+	// DeleteMany deletes every object named by ids.
+	DeleteMany(ids []string) error
+}
+
+// Transaction is returned by TransactionalDataSource.Begin and scopes the
+// operations run against it.
+type Transaction interface {
+	Commit() error
+	Rollback() error
+}
+
+// TransactionalDataSource is an optional extension of DataSource. When a
+// source implements it, the /operations endpoint runs every operation
+// targeting that source inside a single transaction, rolling back on the
+// first error instead of leaving a batch partially applied.
+type TransactionalDataSource interface {
+	Begin() (Transaction, error)
+}
+
+// operation is one entry of the JSON array POSTed to /operations, modeled
+// on the JSON API atomic operations extension.
+type operation struct {
+	Op   string                 `json:"op"`
+	Ref  operationRef           `json:"ref"`
+	Data map[string]interface{} `json:"data"`
+}
+
+type operationRef struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// findResource returns the resource registered under the given JSON API
+// type name, or nil if there is none.
+func (api *API) findResource(name string) *resource {
+	for _, res := range api.resources {
+		if res.name == name {
+			return res
+		}
+	}
+	return nil
+}
+
+// handleOperations is the terminal Handler for ActionOperations, serving
+// POST /operations like any other route: through api.route, so it gets the
+// full API.Use middleware chain, response compression and API.WithTimeout
+// just like resource CRUD routes do. Its body is a JSON array of
+// {op, ref: {type, id}, data} entries, each dispatched to the resource named
+// by ref.type via its BulkDataSource. Operations for the same resource run
+// inside one Transaction when its source is a TransactionalDataSource, so a
+// failure partway through rolls that resource's batch back instead of
+// leaving it half-applied. It writes c.ResponseWriter itself rather than
+// going through a resource's respond, since results span resource types.
+func (api *API) handleOperations(c *Context) error {
+	defer c.Request.Body.Close()
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+
+	var ops []operation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return NewHTTPError(err, "invalid operations payload", http.StatusBadRequest)
+	}
+
+	// results is a heterogeneous []interface{} - one decoded object per
+	// "add"/"update" op (of whichever resource type that op targeted), or
+	// nil for a "remove" - and relies on MarshalToJSON tolerating both a
+	// mixed-type slice and nil entries within it.
+	results := make([]interface{}, len(ops))
+	typeOrder, indicesByType := groupOperationsByType(ops)
+
+	// Dispatched in the order each resource type first appears in ops,
+	// not map iteration order, so partial-failure/rollback behavior is
+	// deterministic across identical requests.
+	for _, typeName := range typeOrder {
+		indices := indicesByType[typeName]
+		res := api.findResource(typeName)
+		if res == nil {
+			return NewHTTPError(nil, "unknown resource type "+typeName, http.StatusBadRequest)
+		}
+
+		bulk, ok := res.source.(BulkDataSource)
+		if !ok {
+			return NewHTTPError(nil, typeName+" does not support bulk operations", http.StatusNotImplemented)
+		}
+
+		if err := res.runOperations(bulk, c.Req, ops, indices, results); err != nil {
+			return err
+		}
+	}
+
+	// handleOperations writes c.ResponseWriter itself rather than going
+	// through a resource's respond, so it needs its own ctx.Err() check -
+	// the same one respond performs for every other route - to avoid
+	// writing a 200 once the client's deadline or cancellation has already
+	// cut the request short.
+	if err := c.StdContext.Err(); err != nil {
+		return translateContextErr(err)
+	}
+
+	return respondWithPaginationAndFields(results, http.StatusOK, c.ResponseWriter, nil, nil, nil)
+}
+
+// groupOperationsByType buckets ops' indices by their ref.type, and records
+// typeOrder as the order each type first appears in ops - so a caller can
+// dispatch per-type batches without map iteration randomizing which type
+// runs first across otherwise-identical requests.
+func groupOperationsByType(ops []operation) (typeOrder []string, indicesByType map[string][]int) {
+	indicesByType = map[string][]int{}
+	for i, op := range ops {
+		if _, seen := indicesByType[op.Ref.Type]; !seen {
+			typeOrder = append(typeOrder, op.Ref.Type)
+		}
+		indicesByType[op.Ref.Type] = append(indicesByType[op.Ref.Type], i)
+	}
+	return typeOrder, indicesByType
+}
+
+// runOperations applies the subset of ops named by indices - all of them
+// targeting res - inside a Transaction when res.source supports one,
+// writing each operation's result (or nil for "remove") into results at its
+// original index.
+func (res *resource) runOperations(bulk BulkDataSource, req Request, ops []operation, indices []int, results []interface{}) error {
+	var tx Transaction
+	if txSource, ok := res.source.(TransactionalDataSource); ok {
+		started, err := txSource.Begin()
+		if err != nil {
+			return err
+		}
+		tx = started
+	}
+
+	if err := res.applyOperations(bulk, req, ops, indices, results); err != nil {
+		if tx != nil {
+			tx.Rollback()
+		}
+		return err
+	}
+
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+func (res *resource) applyOperations(bulk BulkDataSource, req Request, ops []operation, indices []int, results []interface{}) error {
+	for _, i := range indices {
+		op := ops[i]
+		switch op.Op {
+		case "add":
+			obj, err := res.decodeOne(map[string]interface{}{"data": op.Data})
+			if err != nil {
+				return err
+			}
+			ids, err := bulk.CreateMany([]interface{}{obj})
+			if err != nil {
+				return err
+			}
+			created, err := res.source.FindOne(ids[0], req)
+			if err != nil {
+				return err
+			}
+			results[i] = created
+		case "update":
+			existing, err := res.source.FindOne(op.Ref.ID, req)
+			if err != nil {
+				return err
+			}
+			updatingObjs := reflect.MakeSlice(reflect.SliceOf(res.resourceType), 1, 1)
+			updatingObjs.Index(0).Set(reflect.ValueOf(existing))
+			if err := unmarshalInto(map[string]interface{}{"data": op.Data}, res.resourceType, &updatingObjs); err != nil {
+				return err
+			}
+			merged := updatingObjs.Index(0).Interface()
+			if err := bulk.UpdateMany([]interface{}{merged}); err != nil {
+				return err
+			}
+			results[i] = merged
+		case "remove":
+			if err := bulk.DeleteMany([]string{op.Ref.ID}); err != nil {
+				return err
+			}
+			results[i] = nil
+		default:
+			return NewHTTPError(nil, "unknown operation "+op.Op, http.StatusBadRequest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package api2go
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGroupOperationsByTypePreservesFirstSeenOrder(t *testing.T) {
+	ops := []operation{
+		{Op: "add", Ref: operationRef{Type: "posts"}},
+		{Op: "add", Ref: operationRef{Type: "comments"}},
+		{Op: "update", Ref: operationRef{Type: "posts", ID: "1"}},
+		{Op: "remove", Ref: operationRef{Type: "authors", ID: "2"}},
+		{Op: "add", Ref: operationRef{Type: "comments"}},
+	}
+
+	typeOrder, indicesByType := groupOperationsByType(ops)
+
+	wantOrder := []string{"posts", "comments", "authors"}
+	if len(typeOrder) != len(wantOrder) {
+		t.Fatalf("got order %v, want %v", typeOrder, wantOrder)
+	}
+	for i := range wantOrder {
+		if typeOrder[i] != wantOrder[i] {
+			t.Fatalf("got order %v, want %v", typeOrder, wantOrder)
+		}
+	}
+
+	wantIndices := map[string][]int{
+		"posts":    {0, 2},
+		"comments": {1, 4},
+		"authors":  {3},
+	}
+	for typeName, want := range wantIndices {
+		got := indicesByType[typeName]
+		if len(got) != len(want) {
+			t.Fatalf("got indices %v for %q, want %v", got, typeName, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("got indices %v for %q, want %v", got, typeName, want)
+			}
+		}
+	}
+}
+
+func TestHandleOperationsHonorsCanceledContext(t *testing.T) {
+	api := NewAPI("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(http.MethodPost, "/operations", strings.NewReader(`[]`))
+	c := &Context{
+		ResponseWriter: httptest.NewRecorder(),
+		Request:        req,
+		StdContext:     ctx,
+	}
+
+	err := api.handleOperations(c)
+	httpErr, ok := err.(HTTPError)
+	if !ok {
+		t.Fatalf("expected an HTTPError, got %v", err)
+	}
+	if httpErr.status != 499 {
+		t.Fatalf("got status %d, want 499", httpErr.status)
+	}
+}
+
+func TestGroupOperationsByTypeEmpty(t *testing.T) {
+	typeOrder, indicesByType := groupOperationsByType(nil)
+	if len(typeOrder) != 0 || len(indicesByType) != 0 {
+		t.Fatalf("got order %v indices %v, want both empty", typeOrder, indicesByType)
+	}
+}
@@ -0,0 +1,177 @@
+package api2go
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CompressionOptions configures response compression for an API. Compression
+// is off until API.SetCompressionOptions is called, and the zero value (no
+// Encodings) never compresses anything either.
+type CompressionOptions struct {
+	// MinSize is the smallest response body, in bytes, worth compressing.
+	// Responses below this are written uncompressed.
+	MinSize int
+	// Encodings lists the accepted Content-Encoding values, in the order
+	// they should be preferred when a client's Accept-Encoding allows more
+	// than one. Supported values are "gzip" and "deflate".
+	Encodings []string
+	// Level is the compression level passed to compress/gzip or
+	// compress/flate, e.g. gzip.DefaultCompression.
+	Level int
+}
+
+// SetCompressionOptions enables response compression for every resource
+// registered on api, unless a resource opts out via DisableCompression.
+func (api *API) SetCompressionOptions(opts CompressionOptions) {
+	api.compression = &opts
+}
+
+// DisableCompression opts res out of the API-wide CompressionOptions.
+func (res *resource) DisableCompression() *resource {
+	res.compressionDisabled = true
+	return res
+}
+
+// closableResponseWriter is what route's per-request cw local variable
+// needs: a ResponseWriter plus a Close to flush whatever it buffered. Both
+// compressingResponseWriter and the passthrough used when compression isn't
+// configured implement it.
+type closableResponseWriter interface {
+	http.ResponseWriter
+	Close() error
+}
+
+// compressingResponseWriter buffers the response body so the final size is
+// known before any bytes are written, negotiates an encoding from
+// Accept-Encoding, and transparently gzip/deflate-compresses the body when
+// it's worth it. Buffering also lets error responses written via
+// handleError flow through the same negotiation as successful ones.
+type compressingResponseWriter struct {
+	http.ResponseWriter
+	opts     *CompressionOptions
+	encoding string
+	buf      bytes.Buffer
+	status   int
+}
+
+// passthroughResponseWriter is used in place of compressingResponseWriter
+// when compression isn't configured for this request (CompressionOptions
+// was never set, or the resource opted out), so the common case doesn't pay
+// for buffering the entire response body before it can be written.
+type passthroughResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (passthroughResponseWriter) Close() error { return nil }
+
+func newCompressingResponseWriter(w http.ResponseWriter, r *http.Request, opts *CompressionOptions, disabled bool) closableResponseWriter {
+	if opts == nil || disabled {
+		return passthroughResponseWriter{w}
+	}
+	return &compressingResponseWriter{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+		opts:           opts,
+		encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Encodings),
+	}
+}
+
+// WriteHeader only records the status; the real header is written once
+// Close knows whether the body will be compressed.
+func (w *compressingResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *compressingResponseWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// Close decides whether to compress the buffered body and flushes it to the
+// underlying ResponseWriter. It must be called exactly once per request.
+func (w *compressingResponseWriter) Close() error {
+	body := w.buf.Bytes()
+
+	if w.encoding == "" || len(body) < w.minSize() || w.Header().Get("Content-Encoding") != "" {
+		w.ResponseWriter.WriteHeader(w.status)
+		_, err := w.ResponseWriter.Write(body)
+		return err
+	}
+
+	w.Header().Set("Content-Encoding", w.encoding)
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.ResponseWriter.WriteHeader(w.status)
+
+	switch w.encoding {
+	case "gzip":
+		gw, err := gzip.NewWriterLevel(w.ResponseWriter, w.opts.Level)
+		if err != nil {
+			gw = gzip.NewWriter(w.ResponseWriter)
+		}
+		if _, err := gw.Write(body); err != nil {
+			return err
+		}
+		return gw.Close()
+	case "deflate":
+		zw, err := flate.NewWriter(w.ResponseWriter, w.opts.Level)
+		if err != nil {
+			zw, _ = flate.NewWriter(w.ResponseWriter, flate.DefaultCompression)
+		}
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		return zw.Close()
+	}
+	return nil
+}
+
+func (w *compressingResponseWriter) minSize() int {
+	return w.opts.MinSize
+}
+
+// negotiateEncoding returns the first of allowed present in acceptHeader
+// with a nonzero q value, or "" if none match or the client sent
+// "identity"/no preference. A client that explicitly refuses an encoding
+// with ";q=0" (e.g. "gzip;q=0") is honored rather than treated as accepting
+// it.
+func negotiateEncoding(acceptHeader string, allowed []string) string {
+	if acceptHeader == "" {
+		return ""
+	}
+	accepted := map[string]bool{}
+	for _, token := range strings.Split(acceptHeader, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		parts := strings.Split(token, ";")
+		name := strings.TrimSpace(parts[0])
+		accepted[name] = acceptQuality(parts[1:]) > 0
+	}
+	for _, enc := range allowed {
+		if accepted[enc] {
+			return enc
+		}
+	}
+	return ""
+}
+
+// acceptQuality returns the q value among an Accept-Encoding token's
+// ";"-separated parameters, defaulting to 1 if there is none or it fails to
+// parse.
+func acceptQuality(params []string) float64 {
+	for _, param := range params {
+		param = strings.TrimSpace(param)
+		if !strings.HasPrefix(param, "q=") {
+			continue
+		}
+		if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+			return q
+		}
+	}
+	return 1
+}
@@ -0,0 +1,90 @@
+package api2go
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateEncodingPrefersFirstAllowedMatch(t *testing.T) {
+	got := negotiateEncoding("deflate, gzip", []string{"gzip", "deflate"})
+	if got != "gzip" {
+		t.Fatalf("got %q, want gzip", got)
+	}
+}
+
+func TestNegotiateEncodingHonorsExplicitRefusal(t *testing.T) {
+	got := negotiateEncoding("gzip;q=0, deflate", []string{"gzip", "deflate"})
+	if got != "deflate" {
+		t.Fatalf("got %q, want deflate: gzip;q=0 should be treated as refused", got)
+	}
+}
+
+func TestNegotiateEncodingNoMatch(t *testing.T) {
+	got := negotiateEncoding("br", []string{"gzip", "deflate"})
+	if got != "" {
+		t.Fatalf("got %q, want \"\"", got)
+	}
+}
+
+func TestNegotiateEncodingEmptyHeader(t *testing.T) {
+	got := negotiateEncoding("", []string{"gzip"})
+	if got != "" {
+		t.Fatalf("got %q, want \"\"", got)
+	}
+}
+
+func TestNewCompressingResponseWriterPassesThroughWhenUnconfigured(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	cw := newCompressingResponseWriter(rec, r, nil, false)
+	if _, ok := cw.(passthroughResponseWriter); !ok {
+		t.Fatalf("got %T, want passthroughResponseWriter when opts is nil", cw)
+	}
+
+	if _, err := cw.Write([]byte("hi")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Body.String() != "hi" {
+		t.Fatalf("got %q, want body written straight through", rec.Body.String())
+	}
+}
+
+func TestNewCompressingResponseWriterPassesThroughWhenDisabled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	cw := newCompressingResponseWriter(rec, r, &CompressionOptions{Encodings: []string{"gzip"}}, true)
+	if _, ok := cw.(passthroughResponseWriter); !ok {
+		t.Fatalf("got %T, want passthroughResponseWriter when disabled for this resource", cw)
+	}
+}
+
+func TestNewCompressingResponseWriterBuffersWhenConfigured(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	cw := newCompressingResponseWriter(rec, r, &CompressionOptions{Encodings: []string{"gzip"}}, false)
+	if _, ok := cw.(*compressingResponseWriter); !ok {
+		t.Fatalf("got %T, want *compressingResponseWriter when compression is configured", cw)
+	}
+}
+
+func TestDisableCompressionOptsResourceOutOfRequests(t *testing.T) {
+	api := NewAPI("")
+	api.SetCompressionOptions(CompressionOptions{Encodings: []string{"gzip"}})
+	api.AddResourceWithOptions(widget{}, &recordingSource{}).DisableCompression()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/widgets", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	api.Handler().ServeHTTP(rec, req)
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Fatalf("got Content-Encoding %q, want none: DisableCompression should opt this resource out", enc)
+	}
+}
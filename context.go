@@ -0,0 +1,85 @@
+package api2go
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Action identifies which CRUD operation a Context was built for, so a
+// Middleware can tell what it's wrapping without type-switching on the
+// resource's DataSource.
+type Action string
+
+// The actions a Context can carry: one per resource CRUD route, plus
+// ActionOperations for the shared /operations route.
+const (
+	ActionFindAll    Action = "findAll"
+	ActionFindOne    Action = "findOne"
+	ActionCreate     Action = "create"
+	ActionUpdate     Action = "update"
+	ActionDelete     Action = "delete"
+	ActionOperations Action = "operations"
+)
+
+// Context carries everything a Middleware needs for a single request: the
+// raw request/response pair, the parsed api2go Request, which resource and
+// action are being served, and a standard context.Context for cancellation
+// and request-scoped values. It replaces the positional hooks of Controller.
+type Context struct {
+	ResponseWriter http.ResponseWriter
+	Request        *http.Request
+	Params         httprouter.Params
+	Req            Request
+	ResourceName   string
+	Action         Action
+	StdContext     context.Context
+
+	// Result holds the object(s) the action works with: the slice for
+	// FindAll, the single object for FindOne/Create/Update. A Middleware
+	// may read or replace it before the chain continues.
+	Result interface{}
+
+	// Meta and Links are merged into the top-level JSON API document by
+	// the final respond step, e.g. pagination info set by handleIndex.
+	Meta  map[string]interface{}
+	Links map[string]interface{}
+
+	// Locations holds one URL per created object for a bulk create,
+	// reported as meta.locations instead of a single Location header.
+	Locations []string
+
+	values map[string]interface{}
+}
+
+// Set stores a request-scoped value, e.g. the request ID or an
+// authenticated user loaded by an earlier Middleware.
+func (c *Context) Set(key string, value interface{}) {
+	if c.values == nil {
+		c.values = map[string]interface{}{}
+	}
+	c.values[key] = value
+}
+
+// Get retrieves a request-scoped value previously stored with Set.
+func (c *Context) Get(key string) (interface{}, bool) {
+	value, ok := c.values[key]
+	return value, ok
+}
+
+// Handler processes a Context. It is the unit of work a Middleware wraps.
+type Handler func(c *Context) error
+
+// Middleware wraps a Handler with cross-cutting behaviour such as auth,
+// logging, request IDs, tracing, or rate limiting.
+type Middleware func(next Handler) Handler
+
+// chain applies middlewares around h, with the first middleware in the
+// slice running outermost.
+func chain(h Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
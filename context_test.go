@@ -0,0 +1,70 @@
+package api2go
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChainOrdersMiddlewareOutermostFirst(t *testing.T) {
+	var calls []string
+
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *Context) error {
+				calls = append(calls, name+":before")
+				err := next(c)
+				calls = append(calls, name+":after")
+				return err
+			}
+		}
+	}
+
+	term := func(c *Context) error {
+		calls = append(calls, "term")
+		return nil
+	}
+
+	h := chain(term, []Middleware{record("outer"), record("inner")})
+	if err := h(&Context{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"outer:before", "inner:before", "term", "inner:after", "outer:after"}
+	if len(calls) != len(want) {
+		t.Fatalf("got %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("got %v, want %v", calls, want)
+		}
+	}
+}
+
+func TestChainPropagatesTerminalError(t *testing.T) {
+	boom := errors.New("boom")
+	term := func(c *Context) error { return boom }
+
+	h := chain(term, []Middleware{func(next Handler) Handler {
+		return func(c *Context) error { return next(c) }
+	}})
+
+	if err := h(&Context{}); err != boom {
+		t.Fatalf("got %v, want %v", err, boom)
+	}
+}
+
+func TestChainWithNoMiddlewareReturnsTerm(t *testing.T) {
+	called := false
+	term := func(c *Context) error {
+		called = true
+		return nil
+	}
+
+	h := chain(term, nil)
+	if err := h(&Context{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !called {
+		t.Fatal("expected term to be called")
+	}
+}
@@ -0,0 +1,49 @@
+package api2go
+
+// widget is the prototype struct used by the end-to-end resource-route
+// tests that drive a request through api.Handler().
+type widget struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// recordingSource is a DataSource that records which methods were called,
+// so a test can assert a blocked request never reached it.
+type recordingSource struct {
+	obj widget
+
+	findAllCalled bool
+	findOneCalled bool
+	createCalled  bool
+	updateCalled  bool
+	deleteCalled  bool
+}
+
+func (s *recordingSource) FindAll(req Request) (interface{}, error) {
+	s.findAllCalled = true
+	return []widget{s.obj}, nil
+}
+
+func (s *recordingSource) FindOne(id string, req Request) (interface{}, error) {
+	s.findOneCalled = true
+	return s.obj, nil
+}
+
+func (s *recordingSource) FindMultiple(ids []string, req Request) (interface{}, error) {
+	return []widget{s.obj}, nil
+}
+
+func (s *recordingSource) Create(obj interface{}) (string, error) {
+	s.createCalled = true
+	return "1", nil
+}
+
+func (s *recordingSource) Delete(id string) error {
+	s.deleteCalled = true
+	return nil
+}
+
+func (s *recordingSource) Update(obj interface{}) error {
+	s.updateCalled = true
+	return nil
+}
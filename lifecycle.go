@@ -0,0 +1,73 @@
+package api2go
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// trimTrailingSlashHandler redirects a request whose path ends in "/" (and
+// is longer than the bare prefix) to the same path without it, before next
+// ever sees it. The redirect uses 308 (Permanent Redirect) rather than 301,
+// so clients - including net/http's own - replay the original method and
+// body instead of silently downgrading a POST/PUT/DELETE to a GET.
+func trimTrailingSlashHandler(next http.Handler, prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) > len(prefix) && strings.HasSuffix(r.URL.Path, "/") {
+			redirectURL := *r.URL
+			redirectURL.Path = strings.TrimSuffix(r.URL.Path, "/")
+			http.Redirect(w, r, redirectURL.String(), http.StatusPermanentRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Start begins serving HTTP on addr using an *http.Server owned by api. It
+// blocks until the server stops - via Stop, or a listener error - returning
+// nil for a graceful shutdown instead of the http.ErrServerClosed sentinel.
+func (api *API) Start(addr string) error {
+	api.srv = &http.Server{Addr: addr, Handler: api.Handler()}
+	if err := api.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// StartTLS does the same as Start but serves HTTPS using certFile/keyFile.
+func (api *API) StartTLS(addr, certFile, keyFile string) error {
+	api.srv = &http.Server{Addr: addr, Handler: api.Handler()}
+	if err := api.srv.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Stop gracefully shuts down the server started by Start/StartTLS, letting
+// in-flight requests finish until ctx is done. It is a no-op if the server
+// was never started.
+func (api *API) Stop(ctx context.Context) error {
+	if api.srv == nil {
+		return nil
+	}
+	return api.srv.Shutdown(ctx)
+}
+
+// StopOnSignal installs handlers for the given signals (SIGINT/SIGTERM if
+// none are given) that call Stop once Start/StartTLS is serving, so a
+// deployment's normal shutdown signal drains in-flight requests instead of
+// killing connections outright.
+func (api *API) StopOnSignal(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		<-ch
+		api.Stop(context.Background())
+	}()
+}
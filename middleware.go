@@ -0,0 +1,121 @@
+package api2go
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Use registers middlewares that run for every resource registered on api,
+// outermost first, ahead of any middleware passed to
+// AddResourceWithMiddleware.
+func (api *API) Use(middlewares ...Middleware) {
+	api.middleware = append(api.middleware, middlewares...)
+}
+
+// AddResourceWithMiddleware does the same as AddResource but also installs
+// middlewares around every route for this resource, in addition to the ones
+// registered globally via API.Use.
+func (api *API) AddResourceWithMiddleware(prototype interface{}, source DataSource, middlewares ...Middleware) *resource {
+	res := api.addResource(prototype, source)
+	res.middleware = middlewares
+	return res
+}
+
+// requestIDKey is the Context value key used by RequestIDMiddleware.
+const requestIDKey = "api2go.requestID"
+
+// RecoveryMiddleware recovers from panics in the rest of the chain and
+// turns them into a 500 response instead of crashing the server.
+func RecoveryMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Println("api2go: recovered from panic:", r)
+					err = NewHTTPError(nil, "internal server error", http.StatusInternalServerError)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// RequestIDMiddleware assigns a request ID - read from the X-Request-Id
+// header if present, generated otherwise - stores it on the Context, and
+// echoes it back on the response.
+func RequestIDMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			id := c.Request.Header.Get("X-Request-Id")
+			if id == "" {
+				id = newRequestID()
+			}
+			c.Set(requestIDKey, id)
+			c.ResponseWriter.Header().Set("X-Request-Id", id)
+			return next(c)
+		}
+	}
+}
+
+// LoggerMiddleware logs the method, path, resource action and duration of
+// every request once the rest of the chain has run.
+func LoggerMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			start := time.Now()
+			err := next(c)
+			log.Printf("api2go: %s %s [%s] took %s", c.Request.Method, c.Request.URL.Path, c.Action, time.Since(start))
+			return err
+		}
+	}
+}
+
+// newRequestID returns a random 16-byte hex token for RequestIDMiddleware.
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// controllerMiddleware adapts a deprecated Controller to the Middleware
+// chain so AddResourceWithController keeps working unchanged: pre-hook
+// actions (Create/Update/Delete) run before the rest of the chain, post-hook
+// actions (FindAll/FindOne) run after it, exactly as the direct calls used
+// to in handleCreate/handleUpdate/handleDelete/handleIndex/handleRead.
+func controllerMiddleware(controller Controller) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			switch c.Action {
+			case ActionCreate:
+				if err := controller.Create(c.Request, &c.Result); err != nil {
+					return err
+				}
+			case ActionUpdate:
+				if err := controller.Update(c.Request, &c.Result); err != nil {
+					return err
+				}
+			case ActionDelete:
+				if err := controller.Delete(c.Request, c.Params.ByName("id")); err != nil {
+					return err
+				}
+			}
+
+			if err := next(c); err != nil {
+				return err
+			}
+
+			switch c.Action {
+			case ActionFindAll:
+				return controller.FindAll(c.Request, &c.Result)
+			case ActionFindOne:
+				return controller.FindOne(c.Request, &c.Result)
+			}
+			return nil
+		}
+	}
+}
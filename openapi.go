@@ -0,0 +1,414 @@
+package api2go
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// OpenAPIInfo fills the `info` object of the generated OpenAPI document.
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// ResourceOption customizes the OpenAPI metadata for a single resource.
+// Pass one or more to AddResourceWithOptions.
+type ResourceOption func(*resource)
+
+// WithTags sets the OpenAPI tags listed against every operation for a
+// resource.
+func WithTags(tags ...string) ResourceOption {
+	return func(res *resource) {
+		res.openAPITags = tags
+	}
+}
+
+// WithDescription sets the OpenAPI summary used for a resource's
+// operations, in place of the defaults "List <name>", "Get a <Type> by
+// id", "Create a <Type>", "Update a <Type>" and "Delete a <Type>".
+func WithDescription(description string) ResourceOption {
+	return func(res *resource) {
+		res.openAPIDescription = description
+	}
+}
+
+// AddResourceWithOptions does the same as AddResource but also attaches
+// ResourceOptions such as WithTags or WithDescription, picked up by
+// API.OpenAPI when generating the schema document.
+func (api *API) AddResourceWithOptions(prototype interface{}, source DataSource, opts ...ResourceOption) *resource {
+	res := api.addResource(prototype, source)
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// OpenAPI generates an OpenAPI 3.0 document describing every resource
+// registered on api: a component schema per resource (derived from its
+// prototype struct via reflection, honoring `json` and `api2go` struct
+// tags) plus path items for its CRUD routes using the JSON API envelope.
+func (api *API) OpenAPI(info OpenAPIInfo) ([]byte, error) {
+	infoObj := map[string]interface{}{
+		"title":   info.Title,
+		"version": info.Version,
+	}
+	if info.Description != "" {
+		infoObj["description"] = info.Description
+	}
+
+	schemas := map[string]interface{}{
+		"error": errorSchema(),
+	}
+	paths := map[string]interface{}{}
+
+	for _, res := range api.resources {
+		schemas[res.schemaName()] = res.attributesSchema()
+		res.addOpenAPIPaths(paths)
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.0",
+		"info":    infoObj,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas":    schemas,
+			"parameters": openAPIQueryParameters(),
+		},
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// ServeOpenAPI registers a GET route at path that serves the document built
+// by OpenAPI(info), regenerated on every request so it always reflects the
+// resources currently registered on api.
+func (api *API) ServeOpenAPI(path string, info OpenAPIInfo) {
+	api.router.GET(path, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		doc, err := api.OpenAPI(info)
+		if err != nil {
+			handleError(err, w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	})
+}
+
+// schemaName is the component schema name for a resource, e.g. "Post".
+func (res *resource) schemaName() string {
+	return res.resourceType.Name()
+}
+
+// attributesSchema builds the JSON schema for a resource's attributes
+// object by reflecting over its prototype struct.
+func (res *resource) attributesSchema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	t := res.resourceType
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonName, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		tag := parseAPI2GoTag(field.Tag.Get("api2go"))
+		if tag.Ignore {
+			continue
+		}
+
+		prop := map[string]interface{}{"type": jsonSchemaType(field.Type)}
+		if tag.Description != "" {
+			prop["description"] = tag.Description
+		}
+		if len(tag.Enum) > 0 {
+			prop["enum"] = tag.Enum
+		}
+		properties[jsonName] = prop
+
+		if tag.Required {
+			required = append(required, jsonName)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// jsonFieldName returns the attribute name for field per its `json` tag, or
+// its Go name if there is none. skip is true for `json:"-"` fields.
+func jsonFieldName(field reflect.StructField) (name string, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	if tag == "" {
+		return field.Name, false
+	}
+	name = strings.Split(tag, ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+// api2goTag holds the directives parsed out of an `api2go:"..."` struct
+// tag: `;`-separated, either a bare flag (required, ignore) or a
+// `key=value` pair (enum=a,b,c / description=...).
+type api2goTag struct {
+	Required    bool
+	Ignore      bool
+	Enum        []string
+	Description string
+}
+
+func parseAPI2GoTag(tag string) api2goTag {
+	var parsed api2goTag
+	for _, part := range strings.Split(tag, ";") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+			continue
+		case part == "required":
+			parsed.Required = true
+		case part == "ignore":
+			parsed.Ignore = true
+		case strings.HasPrefix(part, "enum="):
+			parsed.Enum = strings.Split(strings.TrimPrefix(part, "enum="), ",")
+		case strings.HasPrefix(part, "description="):
+			parsed.Description = strings.TrimPrefix(part, "description=")
+		}
+	}
+	return parsed
+}
+
+// jsonSchemaType maps a Go field type to a JSON schema `type`.
+func jsonSchemaType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Ptr:
+		return jsonSchemaType(t.Elem())
+	default:
+		return "string"
+	}
+}
+
+// addOpenAPIPaths registers the path items for res's CRUD routes into
+// paths, keyed by the same paths httprouter was given, with its ":id"
+// parameter written in OpenAPI form as "{id}".
+func (res *resource) addOpenAPIPaths(paths map[string]interface{}) {
+	collectionPath := res.prefix + res.name
+	itemPath := res.prefix + res.name + "/{id}"
+
+	tags := res.openAPITags
+	if len(tags) == 0 {
+		tags = []string{res.name}
+	}
+
+	dataRef := map[string]interface{}{"$ref": "#/components/schemas/" + res.schemaName()}
+	objectSchema := func() map[string]interface{} {
+		return map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":       map[string]interface{}{"type": "string"},
+				"id":         map[string]interface{}{"type": "string"},
+				"attributes": dataRef,
+			},
+		}
+	}
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/error"}},
+		},
+	}
+	okResponse := func(description string, data interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{"data": data},
+					},
+				},
+			},
+		}
+	}
+
+	paths[collectionPath] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "list" + res.schemaName(),
+			"summary":     res.openAPISummary("collection"),
+			"tags":        tags,
+			"parameters": []interface{}{
+				map[string]interface{}{"$ref": "#/components/parameters/page"},
+				map[string]interface{}{"$ref": "#/components/parameters/sort"},
+				map[string]interface{}{"$ref": "#/components/parameters/filter"},
+				map[string]interface{}{"$ref": "#/components/parameters/fields"},
+				map[string]interface{}{"$ref": "#/components/parameters/include"},
+			},
+			"responses": map[string]interface{}{
+				"200": okResponse("A page of "+res.name, map[string]interface{}{"type": "array", "items": objectSchema()}),
+				"400": errorResponse,
+			},
+		},
+		"post": map[string]interface{}{
+			"operationId": "create" + res.schemaName(),
+			"summary":     res.openAPISummary("create"),
+			"tags":        tags,
+			"requestBody": map[string]interface{}{
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{
+							"type":       "object",
+							"properties": map[string]interface{}{"data": objectSchema()},
+						},
+					},
+				},
+			},
+			"responses": map[string]interface{}{
+				"201": okResponse("The created "+res.schemaName(), objectSchema()),
+				"400": errorResponse,
+			},
+		},
+	}
+
+	paths[itemPath] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "get" + res.schemaName(),
+			"summary":     res.openAPISummary("item"),
+			"tags":        tags,
+			"parameters":  []interface{}{idParameter()},
+			"responses": map[string]interface{}{
+				"200": okResponse("A single "+res.schemaName(), objectSchema()),
+				"404": errorResponse,
+			},
+		},
+		"put": map[string]interface{}{
+			"operationId": "update" + res.schemaName(),
+			"summary":     res.openAPISummary("update"),
+			"tags":        tags,
+			"parameters":  []interface{}{idParameter()},
+			"requestBody": map[string]interface{}{
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{
+							"type":       "object",
+							"properties": map[string]interface{}{"data": objectSchema()},
+						},
+					},
+				},
+			},
+			"responses": map[string]interface{}{
+				"204": map[string]interface{}{"description": "Updated"},
+				"400": errorResponse,
+				"404": errorResponse,
+			},
+		},
+		"delete": map[string]interface{}{
+			"operationId": "delete" + res.schemaName(),
+			"summary":     res.openAPISummary("delete"),
+			"tags":        tags,
+			"parameters":  []interface{}{idParameter()},
+			"responses": map[string]interface{}{
+				"204": map[string]interface{}{"description": "Deleted"},
+				"404": errorResponse,
+			},
+		},
+	}
+}
+
+func (res *resource) openAPISummary(kind string) string {
+	if res.openAPIDescription != "" {
+		return res.openAPIDescription
+	}
+	switch kind {
+	case "collection":
+		return "List " + res.name
+	case "item":
+		return "Get a " + res.schemaName() + " by id"
+	case "create":
+		return "Create a " + res.schemaName()
+	case "update":
+		return "Update a " + res.schemaName()
+	default:
+		return "Delete a " + res.schemaName()
+	}
+}
+
+func idParameter() map[string]interface{} {
+	return map[string]interface{}{
+		"name":     "id",
+		"in":       "path",
+		"required": true,
+		"schema":   map[string]interface{}{"type": "string"},
+	}
+}
+
+// openAPIQueryParameters describes the JSON API query parameters every
+// collection route accepts, as reusable components.
+func openAPIQueryParameters() map[string]interface{} {
+	return map[string]interface{}{
+		"page":    queryParameter("page[number]", "Pagination, e.g. page[number] and page[size]"),
+		"sort":    queryParameter("sort", "Comma-separated sort fields, prefix with - for descending"),
+		"filter":  queryParameter("filter[attribute]", "Filter objects by an attribute value"),
+		"fields":  queryParameter("fields[type]", "Comma-separated sparse fieldset for a resource type"),
+		"include": queryParameter("include", "Comma-separated related resources to include"),
+	}
+}
+
+func queryParameter(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"required":    false,
+		"description": description,
+		"schema":      map[string]interface{}{"type": "string"},
+	}
+}
+
+// errorSchema describes the JSON API error envelope api2go's handleError
+// writes for an HTTPError.
+func errorSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"errors": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"status": map[string]interface{}{"type": "string"},
+						"title":  map[string]interface{}{"type": "string"},
+						"detail": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+}
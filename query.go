@@ -0,0 +1,201 @@
+package api2go
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Pagination holds the parsed JSON API `page[...]` query parameters.
+// Not every field will be set; a `DataSource` should only look at the ones
+// it supports (e.g. number/size for page-based, offset/limit for the rest).
+type Pagination struct {
+	Number int
+	Size   int
+	Offset int
+	Limit  int
+}
+
+// SortField is a single parsed token of the `sort` query parameter.
+type SortField struct {
+	Name       string
+	Descending bool
+}
+
+func parsePagination(params map[string][]string) (Pagination, error) {
+	var p Pagination
+	for key, values := range params {
+		if !strings.HasPrefix(key, "page[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		name := key[len("page[") : len(key)-1]
+		value, err := strconv.Atoi(values[0])
+		if err != nil {
+			return Pagination{}, NewHTTPError(err, "invalid page["+name+"] parameter", http.StatusBadRequest)
+		}
+		switch name {
+		case "number":
+			p.Number = value
+		case "size":
+			p.Size = value
+		case "offset":
+			p.Offset = value
+		case "limit":
+			p.Limit = value
+		default:
+			return Pagination{}, NewHTTPError(nil, "unknown pagination parameter page["+name+"]", http.StatusBadRequest)
+		}
+	}
+	return p, nil
+}
+
+func parseSorting(params map[string][]string) ([]SortField, error) {
+	values, ok := params["sort"]
+	if !ok || len(values) == 0 {
+		return nil, nil
+	}
+	var fields []SortField
+	for _, token := range values {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return nil, NewHTTPError(nil, "empty sort token", http.StatusBadRequest)
+		}
+		field := SortField{Name: token}
+		if strings.HasPrefix(token, "-") {
+			field.Descending = true
+			field.Name = token[1:]
+		}
+		if field.Name == "" {
+			return nil, NewHTTPError(nil, "empty sort token", http.StatusBadRequest)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// parseBracketedParams extracts `prefix[key]=a,b,c` query parameters into a
+// map keyed by `key`, used for both `fields[type]` and `filter[attribute]`.
+func parseBracketedParams(params map[string][]string, prefix string) map[string][]string {
+	result := map[string][]string{}
+	for key, values := range params {
+		if !strings.HasPrefix(key, prefix+"[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		name := key[len(prefix)+1 : len(key)-1]
+		result[name] = values
+	}
+	return result
+}
+
+// buildPaginationLinks builds the JSON API `links.first/prev/next/last`
+// object for a page-based collection of `count` total objects.
+func buildPaginationLinks(base string, p Pagination, count uint) map[string]interface{} {
+	if p.Number == 0 && p.Size == 0 {
+		return nil
+	}
+	size := p.Size
+	if size == 0 {
+		size = 1
+	}
+	last := (int(count) + size - 1) / size
+	if last < 1 {
+		last = 1
+	}
+
+	links := map[string]interface{}{
+		"first": pageLink(base, 1, size),
+		"last":  pageLink(base, last, size),
+	}
+	if p.Number > 1 {
+		links["prev"] = pageLink(base, p.Number-1, size)
+	}
+	if p.Number < last {
+		links["next"] = pageLink(base, p.Number+1, size)
+	}
+	return links
+}
+
+func pageLink(base string, number, size int) string {
+	return base + "?page[number]=" + strconv.Itoa(number) + "&page[size]=" + strconv.Itoa(size)
+}
+
+// respondWithPaginationAndFields marshals obj with MarshalToJSON, then merges
+// in top-level meta/links and, when fields is non-empty, strips attributes
+// from the JSON API `data` member that weren't requested via `fields[type]`.
+func respondWithPaginationAndFields(obj interface{}, status int, w http.ResponseWriter, meta, links map[string]interface{}, fields []string) error {
+	data, err := MarshalToJSON(obj)
+	if err != nil {
+		return err
+	}
+
+	if len(meta) > 0 || len(links) > 0 || len(fields) > 0 {
+		data, err = patchTopLevelDocument(data, meta, links, fields)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
+
+func patchTopLevelDocument(data []byte, meta, links map[string]interface{}, fields []string) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return data, nil
+	}
+
+	if len(fields) > 0 {
+		allowed := map[string]bool{}
+		for _, f := range fields {
+			allowed[f] = true
+		}
+		switch v := doc["data"].(type) {
+		case map[string]interface{}:
+			filterAttributes(v, allowed)
+		case []interface{}:
+			for _, entry := range v {
+				if obj, ok := entry.(map[string]interface{}); ok {
+					filterAttributes(obj, allowed)
+				}
+			}
+		}
+	}
+
+	if len(meta) > 0 {
+		doc["meta"] = mergeMap(doc["meta"], meta)
+	}
+	if len(links) > 0 {
+		doc["links"] = mergeMap(doc["links"], links)
+	}
+
+	return json.Marshal(doc)
+}
+
+func filterAttributes(entry map[string]interface{}, allowed map[string]bool) {
+	attrs, ok := entry["attributes"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key := range attrs {
+		if !allowed[key] {
+			delete(attrs, key)
+		}
+	}
+}
+
+func mergeMap(existing interface{}, additions map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	if m, ok := existing.(map[string]interface{}); ok {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	for k, v := range additions {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,224 @@
+package api2go
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// StreamingDataSource is an optional extension of DataSource for resources
+// whose collections are too large to materialize in memory. When a source
+// implements it, the GET collection route streams each object onto the
+// response as soon as it arrives on out instead of buffering the whole
+// slice through FindAll/PaginatedFindAll.
+//
+// Because the response is written incrementally, streamed routes bypass
+// CompressionOptions, and an API.WithTimeout deadline is not turned into a
+// 504: once it has passed, the stream is aborted when the next object
+// arrives. StreamAll should watch req.Context itself and stop sending once
+// it's done.
+type StreamingDataSource interface {
+	// StreamAll sends every object for req on out and closes it once done,
+	// or returns an error if the source couldn't even start.
+	StreamAll(req Request, out chan<- interface{}) error
+}
+
+// streamRoute builds the GET collection handler used instead of res.route
+// when res.source implements StreamingDataSource.
+func (res *resource) streamRoute(api *API) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		req, err := buildRequest(r)
+		if err != nil {
+			handleError(err, w)
+			return
+		}
+		if api.timeout > 0 {
+			var cancel context.CancelFunc
+			req.Context, cancel = context.WithTimeout(req.Context, api.timeout)
+			defer cancel()
+		}
+
+		c := &Context{
+			ResponseWriter: w,
+			Request:        r,
+			Params:         ps,
+			Req:            req,
+			ResourceName:   res.name,
+			Action:         ActionFindAll,
+			StdContext:     req.Context,
+		}
+
+		middlewares := append(append([]Middleware{}, api.middleware...), res.middleware...)
+		h := chain(func(c *Context) error {
+			return res.streamIndex(w, c)
+		}, middlewares)
+
+		if err := h(c); err != nil {
+			handleError(err, w)
+		}
+	}
+}
+
+// streamIndex writes the JSON API envelope for a streamed collection: it
+// opens `{"data":[`, encodes each object as it arrives on the channel
+// StreamAll feeds, flushing after every one, and closes the array with
+// whatever c.Meta/c.Links already hold (e.g. set by an earlier Middleware)
+// folded in alongside it, same as a buffered response's top-level document.
+//
+// Nothing is written until either the first object arrives or StreamAll
+// ends, so a source that fails before producing anything still gets a
+// normal JSON API error response instead of a 200. Once the 200 and opening
+// bracket are committed, the status can no longer change - a failure from
+// here on (StreamAll erroring, an Encode failing, or the client's context
+// ending) aborts the underlying connection instead of writing a closing
+// `]}`, so the response body is left truncated/invalid JSON rather than
+// looking like a complete, successful collection. Either way out is fully
+// drained in the background so StreamAll's sender is never left blocked.
+func (res *resource) streamIndex(w http.ResponseWriter, c *Context) error {
+	source, ok := res.source.(StreamingDataSource)
+	if !ok {
+		return NewHTTPError(nil, res.name+" does not support streaming", http.StatusNotImplemented)
+	}
+
+	out := make(chan interface{})
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- source.StreamAll(c.Req, out)
+	}()
+
+	// out is unbuffered, so StreamAll can only have closed it (making
+	// streamErr ready too, since it sends there right after) once every
+	// object has been received - the two cases below can never both be
+	// ready at once while an object is still waiting to be read. A nil
+	// result read here is put back on streamErr (capacity 1, now empty) for
+	// the loop below, which reads it again once out is closed.
+	var pending interface{}
+	var havePending bool
+	select {
+	case obj, ok := <-out:
+		if ok {
+			pending, havePending = obj, true
+		} else if err := <-streamErr; err != nil {
+			return err
+		} else {
+			streamErr <- nil
+		}
+	case err := <-streamErr:
+		if err != nil {
+			drainStream(out)
+			return err
+		}
+		streamErr <- nil
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(`{"data":[`)); err != nil {
+		drainStream(out)
+		return nil
+	}
+
+	enc := json.NewEncoder(w)
+	first := true
+	writeObj := func(obj interface{}) bool {
+		if !first {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return false
+			}
+		}
+		first = false
+		if err := enc.Encode(obj); err != nil {
+			log.Println("api2go: error encoding streamed object:", err)
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	aborted := false
+	if havePending && !writeObj(pending) {
+		aborted = true
+	}
+
+	// Plain receives, not a select racing streamErr: out is unbuffered,
+	// so it only closes (and only then does StreamAll's error become
+	// available) once every object sent on it has been read here.
+	for !aborted {
+		obj, ok := <-out
+		if !ok {
+			if err := <-streamErr; err != nil {
+				log.Println("api2go: StreamAll error after headers were sent:", err)
+				aborted = true
+			}
+			break
+		}
+		if c.StdContext != nil && c.StdContext.Err() != nil {
+			aborted = true
+			break
+		}
+		if !writeObj(obj) {
+			aborted = true
+		}
+	}
+
+	if aborted {
+		drainStream(out)
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+			}
+		}
+		return nil
+	}
+
+	closing, err := streamClosing(c)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(closing); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// streamClosing builds the bytes that close a streamed collection's JSON
+// array, folding c.Meta/c.Links into the top-level document the same way
+// patchTopLevelDocument does for a buffered response.
+func streamClosing(c *Context) ([]byte, error) {
+	closing := []byte("]")
+	if len(c.Meta) > 0 {
+		meta, err := json.Marshal(c.Meta)
+		if err != nil {
+			return nil, err
+		}
+		closing = append(closing, []byte(`,"meta":`)...)
+		closing = append(closing, meta...)
+	}
+	if len(c.Links) > 0 {
+		links, err := json.Marshal(c.Links)
+		if err != nil {
+			return nil, err
+		}
+		closing = append(closing, []byte(`,"links":`)...)
+		closing = append(closing, links...)
+	}
+	return append(closing, '}'), nil
+}
+
+// drainStream discards any objects StreamAll still has in flight so its
+// sending goroutine never blocks forever on an abandoned stream.
+func drainStream(out <-chan interface{}) {
+	go func() {
+		for range out {
+		}
+	}()
+}
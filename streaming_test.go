@@ -0,0 +1,105 @@
+package api2go
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeStreamingSource struct {
+	objs     []interface{}
+	startErr error
+	midErr   error
+}
+
+func (f *fakeStreamingSource) FindAll(req Request) (interface{}, error)              { return nil, nil }
+func (f *fakeStreamingSource) FindOne(id string, req Request) (interface{}, error)    { return nil, nil }
+func (f *fakeStreamingSource) FindMultiple(ids []string, req Request) (interface{}, error) {
+	return nil, nil
+}
+func (f *fakeStreamingSource) Create(interface{}) (string, error) { return "", nil }
+func (f *fakeStreamingSource) Delete(id string) error             { return nil }
+func (f *fakeStreamingSource) Update(obj interface{}) error       { return nil }
+
+func (f *fakeStreamingSource) StreamAll(req Request, out chan<- interface{}) error {
+	defer close(out)
+	if f.startErr != nil {
+		return f.startErr
+	}
+	for _, o := range f.objs {
+		out <- o
+	}
+	return f.midErr
+}
+
+func TestStreamIndexWritesEachObject(t *testing.T) {
+	res := &resource{name: "widgets", source: &fakeStreamingSource{objs: []interface{}{1, 2, 3}}}
+	rec := httptest.NewRecorder()
+	c := &Context{StdContext: context.Background()}
+
+	if err := res.streamIndex(rec, c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec.Code != 200 {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+	want := `{"data":[1
+,2
+,3
+]}`
+	if rec.Body.String() != want {
+		t.Fatalf("got body %q, want %q", rec.Body.String(), want)
+	}
+}
+
+func TestStreamIndexFailsBeforeFirstObjectWithoutWritingAnything(t *testing.T) {
+	startErr := errors.New("source unavailable")
+	res := &resource{name: "widgets", source: &fakeStreamingSource{startErr: startErr}}
+	rec := httptest.NewRecorder()
+	c := &Context{StdContext: context.Background()}
+
+	err := res.streamIndex(rec, c)
+	if err != startErr {
+		t.Fatalf("got %v, want %v", err, startErr)
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("expected nothing written before the first object, got %q", rec.Body.String())
+	}
+}
+
+func TestStreamIndexIncludesMetaAndLinks(t *testing.T) {
+	res := &resource{name: "widgets", source: &fakeStreamingSource{objs: []interface{}{1, 2}}}
+	rec := httptest.NewRecorder()
+	c := &Context{
+		StdContext: context.Background(),
+		Meta:       map[string]interface{}{"count": 2},
+		Links:      map[string]interface{}{"self": "/widgets"},
+	}
+
+	if err := res.streamIndex(rec, c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"data":[1
+,2
+],"meta":{"count":2},"links":{"self":"/widgets"}}`
+	if rec.Body.String() != want {
+		t.Fatalf("got body %q, want %q", rec.Body.String(), want)
+	}
+}
+
+func TestStreamIndexAbortsInsteadOfClosingArrayOnMidStreamError(t *testing.T) {
+	midErr := errors.New("source failed partway through")
+	res := &resource{name: "widgets", source: &fakeStreamingSource{objs: []interface{}{1}, midErr: midErr}}
+	rec := httptest.NewRecorder()
+	c := &Context{StdContext: context.Background()}
+
+	if err := res.streamIndex(rec, c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := rec.Body.String()
+	if body == `{"data":[1
+]}` {
+		t.Fatalf("got a clean closing array on a mid-stream error, want it left truncated: %q", body)
+	}
+}
@@ -0,0 +1,35 @@
+package api2go
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// WithTimeout bounds every request on api with a context.WithTimeout
+// deadline of d, propagated through Request.Context so a DataSource can
+// bail out of a slow call once the client can no longer see the result.
+// The deadline is enforced cooperatively - api2go never abandons a handler
+// goroutine mid-flight, since doing so would let it keep writing to the
+// response concurrently with whatever runs next. A handler or DataSource
+// that ignores Request.Context still gets a translateContextErr response
+// once it returns, via the check in resource.respond.
+func (api *API) WithTimeout(d time.Duration) *API {
+	api.timeout = d
+	return api
+}
+
+// translateContextErr turns a context.Context error into the HTTPError
+// api2go responds with when a deadline or client disconnect cuts a request
+// short: 504 for a deadline, 499 (client closed request) for a cancellation.
+func translateContextErr(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewHTTPError(err, "request deadline exceeded", http.StatusGatewayTimeout)
+	case errors.Is(err, context.Canceled):
+		return NewHTTPError(err, "client closed request", 499)
+	default:
+		return NewHTTPError(err, "request canceled", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,35 @@
+package api2go
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestTranslateContextErrDeadlineExceeded(t *testing.T) {
+	httpErr, ok := translateContextErr(context.DeadlineExceeded).(HTTPError)
+	if !ok {
+		t.Fatalf("expected an HTTPError")
+	}
+	if httpErr.status != http.StatusGatewayTimeout {
+		t.Fatalf("got status %d, want %d", httpErr.status, http.StatusGatewayTimeout)
+	}
+}
+
+func TestTranslateContextErrCanceled(t *testing.T) {
+	httpErr, ok := translateContextErr(context.Canceled).(HTTPError)
+	if !ok {
+		t.Fatalf("expected an HTTPError")
+	}
+	if httpErr.status != 499 {
+		t.Fatalf("got status %d, want 499", httpErr.status)
+	}
+}
+
+func TestWithTimeoutSetsAPITimeout(t *testing.T) {
+	api := NewAPI("")
+	api.WithTimeout(5)
+	if api.timeout != 5 {
+		t.Fatalf("got %v, want 5", api.timeout)
+	}
+}